@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCatalogReader(t *testing.T) {
+	input := strings.Join([]string{
+		"# a comment line",
+		"",
+		"abc123  path/to/a.txt",
+		"def456  path/to/b.txt",
+		"malformed-line-with-no-space",
+		"   ",
+		"ghi789  path with  two spaces.txt",
+	}, "\n")
+
+	got, err := ParseCatalogReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseCatalogReader: %v", err)
+	}
+
+	want := map[string]string{
+		"abc123": "path/to/a.txt",
+		"def456": "path/to/b.txt",
+		"ghi789": "path with  two spaces.txt",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseCatalogReader returned %d entries, want %d: %v", len(got), len(want), got)
+	}
+	for hash, path := range want {
+		if got[hash] != path {
+			t.Errorf("ParseCatalogReader[%q] = %q, want %q", hash, got[hash], path)
+		}
+	}
+}
+
+func TestParseCatalogReaderEmpty(t *testing.T) {
+	got, err := ParseCatalogReader(strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("ParseCatalogReader: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("ParseCatalogReader(\"\") = %v, want empty map", got)
+	}
+}
+
+func TestWriteCatalogParseCatalogRoundTrip(t *testing.T) {
+	var buf strings.Builder
+	results := []hashResult{
+		{path: "/root/keep/a.txt", sum: "abc123"},
+		{path: "/root/keep/sub/b.txt", sum: "def456"},
+	}
+	if err := WriteCatalog(&buf, "/root/keep", results); err != nil {
+		t.Fatalf("WriteCatalog: %v", err)
+	}
+
+	got, err := ParseCatalogReader(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("ParseCatalogReader: %v", err)
+	}
+	if got["abc123"] != "a.txt" || got["def456"] != "sub/b.txt" {
+		t.Errorf("round trip through WriteCatalog/ParseCatalogReader = %v, want relative paths a.txt and sub/b.txt", got)
+	}
+}
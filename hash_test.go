@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// base58Decode reverses base58Encode; it exists only to let the tests
+// below assert a round trip, since production code never needs to
+// decode a multihash it just wrote.
+func base58Decode(s string) []byte {
+	base := big.NewInt(58)
+	x := new(big.Int)
+	for _, c := range []byte(s) {
+		idx := bytes.IndexByte([]byte(base58Alphabet), c)
+		if idx < 0 {
+			return nil
+		}
+		x.Mul(x, base)
+		x.Add(x, big.NewInt(int64(idx)))
+	}
+
+	out := x.Bytes()
+	var zeros int
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), out...)
+}
+
+func TestBase58EncodeRoundTrip(t *testing.T) {
+	cases := [][]byte{
+		{},
+		{0x00},
+		{0x00, 0x00, 0x01},
+		{0xff, 0xee, 0xdd, 0xcc},
+		{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+	}
+	for _, in := range cases {
+		encoded := base58Encode(in)
+		decoded := base58Decode(encoded)
+		if !bytes.Equal(decoded, in) {
+			t.Errorf("base58Encode(%x) = %q, decoded back to %x, want %x", in, encoded, decoded, in)
+		}
+	}
+}
+
+func TestEncodeMultihashRoundTrip(t *testing.T) {
+	digest := []byte{0xde, 0xad, 0xbe, 0xef}
+	encoded := encodeMultihash(0x01, digest)
+	decoded := base58Decode(encoded)
+	if len(decoded) != 2+len(digest) {
+		t.Fatalf("decoded multihash has length %d, want %d", len(decoded), 2+len(digest))
+	}
+	if decoded[0] != 0x01 {
+		t.Errorf("decoded code = %#x, want 0x01", decoded[0])
+	}
+	if decoded[1] != byte(len(digest)) {
+		t.Errorf("decoded length byte = %d, want %d", decoded[1], len(digest))
+	}
+	if !bytes.Equal(decoded[2:], digest) {
+		t.Errorf("decoded digest = %x, want %x", decoded[2:], digest)
+	}
+}
+
+func TestEncodeMultihashDistinctCodes(t *testing.T) {
+	digest := []byte{0x01, 0x02, 0x03}
+	a := encodeMultihash(0x01, digest)
+	b := encodeMultihash(0x02, digest)
+	if a == b {
+		t.Errorf("encodeMultihash produced the same string for different codes: %q", a)
+	}
+}
+
+func writeTempFile(t *testing.T, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "f")
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("writing temp file: %v", err)
+	}
+	return path
+}
+
+func TestPartialHashSmallFileHashesInFull(t *testing.T) {
+	path := writeTempFile(t, 2*partialHashBytes-1)
+	sum, err := partialHash(path)
+	if err != nil {
+		t.Fatalf("partialHash: %v", err)
+	}
+
+	// a file one byte larger that differs only in its middle byte
+	// would still hash in full below the threshold, so two files this
+	// size with different middles must not collide
+	path2 := filepath.Join(t.TempDir(), "f2")
+	data, _ := os.ReadFile(path)
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path2, data, 0o644); err != nil {
+		t.Fatalf("writing temp file: %v", err)
+	}
+	sum2, err := partialHash(path2)
+	if err != nil {
+		t.Fatalf("partialHash: %v", err)
+	}
+	if sum == sum2 {
+		t.Errorf("partialHash collided for files below the threshold that differ in the middle")
+	}
+}
+
+func TestPartialHashLargeFileIgnoresMiddle(t *testing.T) {
+	path := writeTempFile(t, 3*partialHashBytes)
+	sum, err := partialHash(path)
+	if err != nil {
+		t.Fatalf("partialHash: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	data[len(data)/2] ^= 0xff
+	path2 := filepath.Join(t.TempDir(), "f2")
+	if err := os.WriteFile(path2, data, 0o644); err != nil {
+		t.Fatalf("writing temp file: %v", err)
+	}
+	sum2, err := partialHash(path2)
+	if err != nil {
+		t.Fatalf("partialHash: %v", err)
+	}
+	if sum != sum2 {
+		t.Errorf("partialHash(%q) = %q, partialHash(%q) = %q; want equal since only a head/tail-skipped middle byte differs", path, sum, path2, sum2)
+	}
+}
@@ -1,29 +1,115 @@
 package main
 
 import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"math/big"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"golang.org/x/crypto/blake2b"
 )
 
+// partialHashBytes is how much of the head and tail of a large file is
+// hashed during the partial-hash pre-filter pass.
+const partialHashBytes = 4096
+
+// partialHashThreshold is the minimum file size for a size bucket to go
+// through the partial-hash pre-filter instead of jumping straight to a
+// full hash.
+const partialHashThreshold = 1024 * 1024
+
+// progressInterval controls how often scanHashes logs a progress update
+// while a long hashing pass is running.
+const progressInterval = 5 * time.Second
+
 func main() {
 	var keep, clean string
 	var extensions string
-	var dry bool
+	var dry, fast, multihash bool
+	var jobs int
+	var hashName string
+	var generate, catalogOut, catalogIn string
+	var actionName, trash string
+	var patterns patternList
+	var reportPath, reportFormat string
 
 	flag.StringVar(&keep, "keep", "", "directory to look for dups, but delete nothing")
 	flag.StringVar(&clean, "clean", "", "directory to find and delete dups")
-	flag.BoolVar(&dry, "dry", false, "dry run--make no changes")
-	flag.StringVar(&extensions, "extensions", "", "comma-seperated list of extensions to scan")
+	flag.BoolVar(&dry, "dry", false, "dry run--make no changes, regardless of -action")
+	flag.StringVar(&extensions, "extensions", "", "comma-seperated list of extensions to scan, e.g. `jpg,png` (desugars into -patterns)")
+	flag.Var(&patterns, "patterns", "gitignore-style exclude pattern, e.g. `node_modules/`, `!thumbnails/**` (repeatable, or newline-separated)")
+	flag.BoolVar(&fast, "fast", false, "pre-filter large files with a partial head/tail hash before full hashing")
+	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), "number of files to hash concurrently")
+	flag.StringVar(&hashName, "hash", "sha256", "hash algorithm to use: sha256, sha1, md5, blake2b-256")
+	flag.BoolVar(&multihash, "multihash", false, "encode digests as a self-describing base58 multihash")
+	flag.StringVar(&generate, "generate", "", "directory to scan and hash, writing a catalog instead of comparing to -clean")
+	flag.StringVar(&catalogOut, "out", "", "catalog file to write, used with -generate")
+	flag.StringVar(&catalogIn, "catalog", "", "catalog file to use as the keeper side instead of -keep")
+	flag.StringVar(&actionName, "action", "delete", "what to do with dups found in -clean: print, delete, hardlink, move")
+	flag.StringVar(&trash, "trash", "", "directory to move dups into, required with -action move")
+	flag.StringVar(&reportPath, "report", "", "file to write a machine-readable report of the run to")
+	flag.StringVar(&reportFormat, "report-format", "", "report format: json or ndjson (default: inferred from -report's extension, else json)")
 	flag.Parse()
-	if keep == "" || clean == "" {
-		fmt.Fprintf(os.Stderr, "-keep and -clean are both required\n")
+
+	newHash, hashCode, err := hasherFor(hashName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if err := validateAction(actionName, trash); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	dirMatcher := buildMatcher(patterns)
+	fileMatcher := buildMatcher(append(extensionPatterns(extensions), patterns...))
+
+	rep, err := openReport(reportPath, reportFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating report %s: %v\n", reportPath, err)
+		os.Exit(1)
+	}
+	started := time.Now().UTC().Format(time.RFC3339)
+
+	if generate != "" {
+		if catalogOut == "" {
+			fmt.Fprintf(os.Stderr, "-out is required with -generate\n")
+			os.Exit(1)
+		}
+		rep.writeMeta(reportMeta{
+			Type:      "generate",
+			Keep:      generate,
+			Catalog:   catalogOut,
+			Hash:      hashName,
+			Multihash: multihash,
+			Started:   started,
+		})
+		if err := runGenerate(generate, catalogOut, dirMatcher, fileMatcher, jobs, newHash, multihash, hashCode); err != nil {
+			os.Exit(1)
+		}
+		rep.close(reportSummary{Finished: time.Now().UTC().Format(time.RFC3339)})
+		return
+	}
+
+	if (keep == "" && catalogIn == "") || clean == "" {
+		fmt.Fprintf(os.Stderr, "-clean and one of -keep or -catalog are required\n")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -31,85 +117,419 @@ func main() {
 	if dry {
 		log.Printf("dry run: no files will be deleted")
 	}
-	suffixes := strings.Split(strings.ToLower(extensions), ",")
+
+	rep.writeMeta(reportMeta{
+		Keep:      keep,
+		Clean:     clean,
+		Catalog:   catalogIn,
+		Action:    actionName,
+		Hash:      hashName,
+		Multihash: multihash,
+		Started:   started,
+	})
+
+	if catalogIn != "" {
+		if err := runCatalogClean(catalogIn, clean, dirMatcher, fileMatcher, jobs, newHash, multihash, hashCode, actionName, trash, dry, rep); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// scan for sizes
 	log.Printf("scanning %s for file sizes", keep)
-	keeperSizes, err := scanSizes(keep, suffixes)
+	keeperSizes, err := scanSizes(keep, dirMatcher, fileMatcher)
 	if err != nil {
 		os.Exit(1)
 	}
 	log.Printf("found %d keep file sizes", len(keeperSizes))
 	log.Printf("scanning %s for file sizes", clean)
-	cleanerSizes, err := scanSizes(clean, suffixes)
+	cleanerSizes, err := scanSizes(clean, dirMatcher, fileMatcher)
 	if err != nil {
 		os.Exit(1)
 	}
 	log.Printf("found %d clean file sizes", len(cleanerSizes))
 
 	// find size matches
-	filecount, bytecount := 0, 0
+	filecount, bytecount, errcount := 0, 0, 0
 	for size, keeperNames := range keeperSizes {
 		if cleanerNames, exists := cleanerSizes[size]; exists {
+			keeperCandidates, cleanerCandidates := keeperNames, cleanerNames
+
+			// for large size buckets, narrow down the candidates with a
+			// cheap head+tail hash before paying for a full read
+			if fast && size > partialHashThreshold {
+				keeperPartials, err := scanPartialHashes(keeperNames)
+				if err != nil {
+					os.Exit(1)
+				}
+				cleanerPartials, err := scanPartialHashes(cleanerNames)
+				if err != nil {
+					os.Exit(1)
+				}
+
+				keeperCandidates = nil
+				for key, paths := range keeperPartials {
+					if _, exists := cleanerPartials[key]; exists {
+						keeperCandidates = append(keeperCandidates, paths...)
+					}
+				}
+				cleanerCandidates = nil
+				for key, paths := range cleanerPartials {
+					if _, exists := keeperPartials[key]; exists {
+						cleanerCandidates = append(cleanerCandidates, paths...)
+					}
+				}
+			}
+
 			// scan these files for content hashes
-			keepers, err := scanHashes(keeperNames)
+			keepers, err := scanHashes(keeperCandidates, jobs, newHash, multihash, hashCode)
 			if err != nil {
 				os.Exit(1)
 			}
-			cleaners, err := scanHashes(cleanerNames)
+			cleaners, err := scanHashes(cleanerCandidates, jobs, newHash, multihash, hashCode)
 			if err != nil {
 				os.Exit(1)
 			}
 
-			// delete the dups
+			// handle the dups
 			for key, keeppath := range keepers {
 				if cleanpath, exists := cleaners[key]; exists {
 					filecount++
 					bytecount += size
 
-					if dry {
-						log.Printf("found %s is dup of %s", cleanpath, keeppath)
-					} else {
-						log.Printf("deleting %s (dup of %s)", cleanpath, keeppath)
-						if err := os.Remove(cleanpath); err != nil {
-							log.Fatalf("error removing %s: %v", cleanpath, err)
-						}
+					applyErr := applyAction(keeppath, cleanpath, clean, trash, actionName, dry)
+					rep.addPair(reportPair{
+						Keep:   keeppath,
+						Clean:  cleanpath,
+						Size:   size,
+						Hash:   key,
+						Action: reportActionResult(actionName, dry, applyErr),
+					})
+					if applyErr != nil {
+						errcount++
+						rep.close(reportSummary{FileCount: filecount, ByteCount: bytecount, ErrorCount: errcount, Finished: time.Now().UTC().Format(time.RFC3339)})
+						log.Fatalf("error applying -action %s to %s: %v", actionName, cleanpath, applyErr)
 					}
 				}
 			}
 		}
 	}
 
+	rep.close(reportSummary{FileCount: filecount, ByteCount: bytecount, ErrorCount: errcount, Finished: time.Now().UTC().Format(time.RFC3339)})
+	log.Printf("found %d duplicate files with total size %d (%.2f MB / %.2f GB)", filecount, bytecount, float64(bytecount)/(1024*1024), float64(bytecount)/(1024*1024*1024))
+}
+
+// validateAction checks that actionName is one of the supported -action
+// values and that -trash is present when it's required.
+func validateAction(actionName, trash string) error {
+	switch actionName {
+	case "print", "delete", "hardlink":
+		return nil
+	case "move":
+		if trash == "" {
+			return fmt.Errorf("-trash is required with -action move")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown -action %q: must be print, delete, hardlink, or move", actionName)
+	}
+}
+
+// applyAction logs a found duplicate and, unless dry is set, carries out
+// actionName against cleanpath: deleting it, replacing it with a hardlink
+// to keeppath, or moving it under trash (preserving its path relative to
+// cleanRoot). "print" never touches the filesystem.
+func applyAction(keeppath, cleanpath, cleanRoot, trash, actionName string, dry bool) error {
+	if dry || actionName == "print" {
+		log.Printf("found %s is dup of %s", cleanpath, keeppath)
+		return nil
+	}
+
+	switch actionName {
+	case "delete":
+		log.Printf("deleting %s (dup of %s)", cleanpath, keeppath)
+		return os.Remove(cleanpath)
+	case "hardlink":
+		log.Printf("hardlinking %s to %s", cleanpath, keeppath)
+		return hardlinkDup(keeppath, cleanpath)
+	case "move":
+		log.Printf("moving %s to %s (dup of %s)", cleanpath, trash, keeppath)
+		return moveDup(cleanRoot, trash, cleanpath)
+	default:
+		return fmt.Errorf("unknown -action %q", actionName)
+	}
+}
+
+// hardlinkDup replaces cleanpath with a hardlink to keeppath. It links a
+// temporary name first and renames it over cleanpath, so a failure never
+// leaves cleanpath missing. If keeppath and cleanpath are already the
+// same inode, it's left alone rather than risk destroying the only copy.
+// A cross-device link (EXDEV) falls back to copying the bytes instead.
+func hardlinkDup(keeppath, cleanpath string) error {
+	keepInfo, err := os.Stat(keeppath)
+	if err != nil {
+		return err
+	}
+	cleanInfo, err := os.Stat(cleanpath)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(keepInfo, cleanInfo) {
+		log.Printf("%s is already hardlinked to %s; skipping", cleanpath, keeppath)
+		return nil
+	}
+
+	tmp := cleanpath + ".dedup-tmp"
+	os.Remove(tmp)
+	if err := os.Link(keeppath, tmp); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		log.Printf("%s is on a different device than %s; copying instead of linking", cleanpath, keeppath)
+		if err := copyFile(keeppath, tmp); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp, cleanpath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// moveDup relocates cleanpath under trash, preserving its path relative
+// to cleanRoot. A cross-device move falls back to copying and removing
+// the original.
+func moveDup(cleanRoot, trash, cleanpath string) error {
+	rel, err := filepath.Rel(cleanRoot, cleanpath)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(trash, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(cleanpath, dst); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		if err := copyFile(cleanpath, dst); err != nil {
+			return err
+		}
+		return os.Remove(cleanpath)
+	}
+	return nil
+}
+
+// copyFile copies src to dst via a temporary file in dst's directory,
+// renamed into place once the copy succeeds.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// runGenerate walks dir, hashes everything under it, and writes the
+// results to a catalog file at out. The catalog can later stand in for
+// -keep via -catalog, so a drive can be deduped against a manifest of
+// another drive that isn't attached.
+func runGenerate(dir, out string, dirMatcher, fileMatcher gitignore.Matcher, jobs int, newHash func() hash.Hash, multihash bool, hashCode byte) error {
+	log.Printf("scanning %s for files to catalog", dir)
+	sizes, err := scanSizes(dir, dirMatcher, fileMatcher)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, names := range sizes {
+		paths = append(paths, names...)
+	}
+	log.Printf("hashing %d files for catalog", len(paths))
+	results, err := hashPaths(paths, jobs, newHash, multihash, hashCode)
+	if err != nil {
+		return err
+	}
+
+	fp, err := os.Create(out)
+	if err != nil {
+		log.Printf("error creating catalog %s: %v", out, err)
+		return err
+	}
+	defer fp.Close()
+
+	if err := WriteCatalog(fp, dir, results); err != nil {
+		log.Printf("error writing catalog %s: %v", out, err)
+		return err
+	}
+	log.Printf("wrote catalog of %d files to %s", len(results), out)
+	return nil
+}
+
+// runCatalogClean loads a catalog generated by -generate and uses it as
+// the keeper side, comparing by hash alone since a catalog carries no
+// size information for its (possibly offline) source directory.
+func runCatalogClean(catalog, clean string, dirMatcher, fileMatcher gitignore.Matcher, jobs int, newHash func() hash.Hash, multihash bool, hashCode byte, actionName, trash string, dry bool, rep *report) error {
+	fp, err := os.Open(catalog)
+	if err != nil {
+		log.Printf("error opening catalog %s: %v", catalog, err)
+		return err
+	}
+	keepers, err := ParseCatalogReader(fp)
+	fp.Close()
+	if err != nil {
+		log.Printf("error parsing catalog %s: %v", catalog, err)
+		return err
+	}
+	log.Printf("loaded %d entries from catalog %s", len(keepers), catalog)
+
+	log.Printf("scanning %s for file sizes", clean)
+	cleanerSizes, err := scanSizes(clean, dirMatcher, fileMatcher)
+	if err != nil {
+		return err
+	}
+	var cleanPaths []string
+	for _, names := range cleanerSizes {
+		cleanPaths = append(cleanPaths, names...)
+	}
+
+	cleaners, err := scanHashes(cleanPaths, jobs, newHash, multihash, hashCode)
+	if err != nil {
+		return err
+	}
+
+	filecount, bytecount, errcount := 0, 0, 0
+	for key, keeppath := range keepers {
+		cleanpath, exists := cleaners[key]
+		if !exists {
+			continue
+		}
+		filecount++
+		size := 0
+		if info, err := os.Stat(cleanpath); err == nil {
+			size = int(info.Size())
+			bytecount += size
+		}
+		applyErr := applyAction(keeppath, cleanpath, clean, trash, actionName, dry)
+		rep.addPair(reportPair{
+			Keep:   keeppath,
+			Clean:  cleanpath,
+			Size:   size,
+			Hash:   key,
+			Action: reportActionResult(actionName, dry, applyErr),
+		})
+		if applyErr != nil {
+			errcount++
+			rep.close(reportSummary{FileCount: filecount, ByteCount: bytecount, ErrorCount: errcount, Finished: time.Now().UTC().Format(time.RFC3339)})
+			log.Fatalf("error applying -action %s to %s: %v", actionName, cleanpath, applyErr)
+		}
+	}
+
+	rep.close(reportSummary{FileCount: filecount, ByteCount: bytecount, ErrorCount: errcount, Finished: time.Now().UTC().Format(time.RFC3339)})
 	log.Printf("found %d duplicate files with total size %d (%.2f MB / %.2f GB)", filecount, bytecount, float64(bytecount)/(1024*1024), float64(bytecount)/(1024*1024*1024))
+	return nil
+}
+
+// WriteCatalog writes one "<hash>  <relative-path>" line per result,
+// relative to root, so the catalog can be read back on another machine
+// without caring where root happened to live locally.
+func WriteCatalog(w io.Writer, root string, results []hashResult) error {
+	for _, r := range results {
+		rel, err := filepath.Rel(root, r.path)
+		if err != nil {
+			rel = r.path
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s\n", r.sum, rel); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func scanSizes(root string, suffixes []string) (map[int][]string, error) {
+// ParseCatalogReader reads a catalog written by WriteCatalog into a
+// hash->path map suitable for matching against a scanHashes result.
+// Blank lines and lines starting with # are ignored so catalogs can
+// carry comments.
+func ParseCatalogReader(r io.Reader) (map[string]string, error) {
+	files := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			log.Printf("skipping malformed catalog line: %q", line)
+			continue
+		}
+		files[fields[0]] = strings.TrimSpace(fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// scanSizes walks root, keeping regular files that pass fileMatcher, and
+// grouping their paths by size. dirMatcher and fileMatcher are deliberately
+// separate: dirMatcher (built only from -patterns) decides which
+// directories to prune, while fileMatcher (-patterns plus any -extensions
+// whitelist; see extensionPatterns) decides which files to keep. They
+// can't share a matcher because a dirOnly pattern's match check only
+// rejects a match at the final path segment, so a whitelist like "*" +
+// "!*.jpg" would, if also used to prune directories, match (and prune)
+// every directory outright. Keeping directory recursion driven only by
+// explicit -patterns directory excludes means -extensions restricts
+// files at every depth instead of only at the scan root.
+func scanSizes(root string, dirMatcher, fileMatcher gitignore.Matcher) (map[int][]string, error) {
 	names := make(map[int][]string)
 	err := filepath.Walk(root, func(path string, info os.FileInfo, inerr error) error {
 		if inerr != nil {
 			log.Printf("error walking directories, skipping: %v", inerr)
 			return filepath.SkipDir
 		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			log.Printf("error finding relative path for %s, skipping: %v", path, err)
+			return nil
+		}
+		var segments []string
+		if rel != "." {
+			segments = strings.Split(filepath.ToSlash(rel), "/")
+		}
+
 		if info.IsDir() {
-			//log.Printf(" --> %s", path)
+			if dirMatcher != nil && rel != "." && dirMatcher.Match(segments, true) {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 		if info.Mode()&os.ModeType != 0 {
 			// skip everything but regular files
 			return nil
 		}
 
-		// only consider files with requested extensions
-		if len(suffixes) > 0 {
-			keep := false
-			for _, ext := range suffixes {
-				if strings.HasSuffix(strings.ToLower(path), "."+ext) {
-					keep = true
-					break
-				}
-			}
-			if !keep {
-				return nil
-			}
+		if fileMatcher != nil && fileMatcher.Match(segments, false) {
+			return nil
 		}
 
 		size := int(info.Size())
@@ -123,24 +543,338 @@ func scanSizes(root string, suffixes []string) (map[int][]string, error) {
 	return names, nil
 }
 
-func scanHashes(paths []string) (map[string]string, error) {
-	files := make(map[string]string)
+// patternList collects -patterns values, which may be repeated on the
+// command line or contain several newline-separated patterns in one
+// value.
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			*p = append(*p, line)
+		}
+	}
+	return nil
+}
+
+// extensionPatterns desugars -extensions into the same gitignore-style
+// pattern language -patterns uses, so there's one filtering path instead
+// of two that can interact in surprising ways. -extensions is a whitelist
+// ("only these"), which a plain exclude pattern can't express on its own,
+// so it's expanded to "exclude everything, then un-exclude each
+// extension":
+//
+//	*
+//	!*.jpg
+//	!*.png
+//
+// This is meant to be combined with -patterns into a matcher applied to
+// files only (see buildMatcher and scanSizes), never to directories: a
+// dirOnly pattern like "*/" aimed at re-admitting directories for the
+// walk to recurse into ends up matching files nested under any directory
+// too, since go-git's matcher only rejects a dirOnly match at the final
+// path segment. Keeping this whitelist out of directory pruning entirely
+// is what lets "*.ext" restrict every depth instead of only the scan
+// root.
+//
+// The old suffix filter compared both sides case-folded, so each letter
+// in ext is expanded to a [aA]-style character class here to keep
+// matching -extensions JPG against photo.JPG (and photo.jpg) working.
+func extensionPatterns(extensions string) []string {
+	if extensions == "" {
+		return nil
+	}
+	patterns := []string{"*"}
+	for _, ext := range strings.Split(extensions, ",") {
+		patterns = append(patterns, "!*."+globCaseFold(ext))
+	}
+	return patterns
+}
+
+// globCaseFold rewrites s into a filepath.Match glob that matches s
+// regardless of letter case, e.g. "jpg" -> "[jJ][pP][gG]".
+func globCaseFold(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+		if lower != upper {
+			b.WriteRune('[')
+			b.WriteRune(lower)
+			b.WriteRune(upper)
+			b.WriteRune(']')
+		} else {
+			if strings.ContainsRune(`\*?[]`, r) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// buildMatcher turns a list of gitignore-style patterns into a matcher,
+// same semantics as a real .gitignore file: an unnegated pattern excludes
+// the files it matches, and a leading "!" re-includes files that an
+// earlier, broader pattern excluded. A nil matcher (no patterns given)
+// excludes nothing.
+func buildMatcher(patterns []string) gitignore.Matcher {
+	if len(patterns) == 0 {
+		return nil
+	}
+	ps := make([]gitignore.Pattern, 0, len(patterns))
+	for _, line := range patterns {
+		ps = append(ps, gitignore.ParsePattern(line, nil))
+	}
+	return gitignore.NewMatcher(ps)
+}
+
+// scanPartialHashes hashes only the first and last partialHashBytes of
+// each file, keyed by the resulting digest. It is meant as a cheap
+// pre-filter for scanHashes: files whose partial hashes don't collide
+// can't be full duplicates, so the (expensive) full hash pass only needs
+// to run on the survivors. Files smaller than 2*partialHashBytes are
+// hashed in full here instead, since there would be no head/tail left to
+// skip over. Every path sharing a partial hash is kept, not just the
+// last one seen, since two files on the same side can share a head+tail
+// digest while differing elsewhere.
+func scanPartialHashes(paths []string) (map[string][]string, error) {
+	files := make(map[string][]string)
 	for _, path := range paths {
-		// compute a hash
-		fp, err := os.Open(path)
+		sum, err := partialHash(path)
 		if err != nil {
-			log.Printf("error opening file %s to take hash; skipping: %v", path, err)
+			log.Printf("error computing partial hash for %s; skipping: %v", path, err)
 			continue
 		}
-		hash := sha256.New()
-		if _, err = io.Copy(hash, fp); err != nil {
-			log.Printf("error computing hash for %s; skipping: %v", path, err)
-			fp.Close()
+		files[sum] = append(files[sum], path)
+	}
+	return files, nil
+}
+
+func partialHash(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	info, err := fp.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	if info.Size() < 2*partialHashBytes {
+		if _, err := io.Copy(hash, fp); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	head := make([]byte, partialHashBytes)
+	if _, err := io.ReadFull(fp, head); err != nil {
+		return "", err
+	}
+	hash.Write(head)
+
+	if _, err := fp.Seek(-partialHashBytes, io.SeekEnd); err != nil {
+		return "", err
+	}
+	tail := make([]byte, partialHashBytes)
+	if _, err := io.ReadFull(fp, tail); err != nil {
+		return "", err
+	}
+	hash.Write(tail)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashResult is one file's digest, as produced by hashPaths.
+type hashResult struct {
+	path string
+	sum  string
+}
+
+// hashPaths computes a full hash of each path using newHash, using a pool
+// of jobs worker goroutines so IO and CPU can overlap across files.
+// Errors on individual files are logged and skipped. If multihash is set,
+// digests are encoded as self-describing multihashes tagged with
+// hashCode so a downstream consumer can tell which algorithm produced
+// them; otherwise they're plain hex. Results are returned in whatever
+// order the workers finish in.
+func hashPaths(paths []string, jobs int, newHash func() hash.Hash, multihash bool, hashCode byte) ([]hashResult, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	atomic.StoreInt64(&hashedFiles, 0)
+	atomic.StoreInt64(&hashedBytes, 0)
+
+	type workResult struct {
+		path string
+		sum  string
+		err  error
+	}
+
+	pathCh := make(chan string)
+	resultCh := make(chan workResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pathCh {
+				sum, n, err := hashFile(path, newHash, multihash, hashCode)
+				if err == nil {
+					atomic.AddInt64(&hashedFiles, 1)
+					atomic.AddInt64(&hashedBytes, n)
+				}
+				resultCh <- workResult{path: path, sum: sum, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, path := range paths {
+			pathCh <- path
+		}
+		close(pathCh)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	stopProgress := make(chan struct{})
+	go reportProgress(len(paths), stopProgress)
+
+	var results []hashResult
+	for res := range resultCh {
+		if res.err != nil {
+			log.Printf("error hashing %s; skipping: %v", res.path, res.err)
 			continue
 		}
-		fp.Close()
-		sum := hex.EncodeToString(hash.Sum(nil))
-		files[sum] = path
+		results = append(results, hashResult{path: res.path, sum: res.sum})
+	}
+	close(stopProgress)
+
+	return results, nil
+}
+
+// scanHashes computes a full hash of each path and collects the results
+// into a map keyed by digest. If two paths collide on the same digest,
+// the last one wins, same as it always has here; this is only ever used
+// to find a match between two independent sides, not to enumerate every
+// file on one side.
+func scanHashes(paths []string, jobs int, newHash func() hash.Hash, multihash bool, hashCode byte) (map[string]string, error) {
+	results, err := hashPaths(paths, jobs, newHash, multihash, hashCode)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string, len(results))
+	for _, r := range results {
+		files[r.sum] = r.path
 	}
 	return files, nil
 }
+
+// hashedFiles and hashedBytes track hashing progress for the current
+// hashPaths call so reportProgress can log periodic updates during a long
+// hashing pass. hashPaths resets them at the start of each call, since
+// scanSizes groups files into separate size buckets and each bucket gets
+// its own hashPaths call with its own total.
+var hashedFiles, hashedBytes int64
+
+func reportProgress(total int, stop <-chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			log.Printf("hashed %d/%d files (%d bytes)", atomic.LoadInt64(&hashedFiles), total, atomic.LoadInt64(&hashedBytes))
+		case <-stop:
+			return
+		}
+	}
+}
+
+func hashFile(path string, newHash func() hash.Hash, multihash bool, hashCode byte) (string, int64, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("error opening file %s to take hash: %w", path, err)
+	}
+	defer fp.Close()
+
+	h := newHash()
+	n, err := io.Copy(h, fp)
+	if err != nil {
+		return "", 0, fmt.Errorf("error computing hash for %s: %w", path, err)
+	}
+	digest := h.Sum(nil)
+	if multihash {
+		return encodeMultihash(hashCode, digest), n, nil
+	}
+	return hex.EncodeToString(digest), n, nil
+}
+
+// hasherFor maps a -hash flag value to a hash.Hash constructor and the
+// single-byte code used to tag its digests when -multihash is set. The
+// codes are local to this tool, not the multicodec registry; they only
+// need to round-trip between a run's own writer and reader.
+func hasherFor(name string) (func() hash.Hash, byte, error) {
+	switch name {
+	case "sha256":
+		return sha256.New, 0x01, nil
+	case "sha1":
+		return sha1.New, 0x02, nil
+	case "md5":
+		return md5.New, 0x03, nil
+	case "blake2b-256":
+		return func() hash.Hash {
+			h, _ := blake2b.New256(nil)
+			return h
+		}, 0x04, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown -hash algorithm %q", name)
+	}
+}
+
+// multihash encoding: a 1-byte algorithm code, a 1-byte digest length,
+// then the raw digest, all base58-encoded so it's safe to paste into a
+// report or catalog file alongside file paths.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func encodeMultihash(code byte, digest []byte) string {
+	buf := make([]byte, 0, 2+len(digest))
+	buf = append(buf, code, byte(len(digest)))
+	buf = append(buf, digest...)
+	return base58Encode(buf)
+}
+
+func base58Encode(input []byte) string {
+	zero := new(big.Int)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+	x := new(big.Int).SetBytes(input)
+
+	var out []byte
+	for x.Cmp(zero) > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range input {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
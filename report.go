@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// reportMeta describes a single run, written once at the start of a
+// report.
+type reportMeta struct {
+	Type      string `json:"type,omitempty"`
+	Keep      string `json:"keep,omitempty"`
+	Clean     string `json:"clean"`
+	Catalog   string `json:"catalog,omitempty"`
+	Action    string `json:"action"`
+	Hash      string `json:"hash"`
+	Multihash bool   `json:"multihash"`
+	Started   string `json:"started"`
+}
+
+// reportPair describes one duplicate pair found during a run. Action
+// reflects what actually happened to clean: found, deleted, hardlinked,
+// moved, or error.
+type reportPair struct {
+	Type   string `json:"type,omitempty"`
+	Keep   string `json:"keep"`
+	Clean  string `json:"clean"`
+	Size   int    `json:"size"`
+	Hash   string `json:"hash"`
+	Action string `json:"action"`
+}
+
+// reportSummary carries the run totals, written once at the end of a
+// report.
+type reportSummary struct {
+	Type       string `json:"type,omitempty"`
+	FileCount  int    `json:"file_count"`
+	ByteCount  int    `json:"byte_count"`
+	ErrorCount int    `json:"error_count"`
+	Finished   string `json:"finished"`
+}
+
+// report writes a machine-readable record of a run to -report, as either
+// a single JSON document or NDJSON. NDJSON streams each record as it's
+// written; the JSON document is buffered and assembled on close, since a
+// JSON array can't be closed until every element is known.
+type report struct {
+	fp     *os.File
+	enc    *json.Encoder
+	ndjson bool
+	meta   reportMeta
+	pairs  []reportPair
+}
+
+// openReport creates the report file at path, if path is non-empty.
+// format selects "json" or "ndjson"; if format is empty, it's inferred
+// from path's extension, defaulting to a single JSON document.
+func openReport(path, format string) (*report, error) {
+	if path == "" {
+		return nil, nil
+	}
+	fp, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	ndjson := format == "ndjson"
+	if format == "" {
+		lower := strings.ToLower(path)
+		ndjson = strings.HasSuffix(lower, ".ndjson") || strings.HasSuffix(lower, ".jsonl")
+	}
+	return &report{fp: fp, enc: json.NewEncoder(fp), ndjson: ndjson}, nil
+}
+
+// writeMeta records the run metadata. It's a no-op on a nil report, so
+// callers don't need to guard every call with a -report check.
+func (r *report) writeMeta(meta reportMeta) error {
+	if r == nil {
+		return nil
+	}
+	r.meta = meta
+	if r.ndjson {
+		meta.Type = "meta"
+		return r.enc.Encode(meta)
+	}
+	return nil
+}
+
+// addPair records one duplicate pair.
+func (r *report) addPair(pair reportPair) error {
+	if r == nil {
+		return nil
+	}
+	if r.ndjson {
+		pair.Type = "pair"
+		return r.enc.Encode(pair)
+	}
+	r.pairs = append(r.pairs, pair)
+	return nil
+}
+
+// close writes the trailing summary and, for a JSON document, the
+// buffered meta and pairs, then closes the underlying file.
+func (r *report) close(summary reportSummary) error {
+	if r == nil {
+		return nil
+	}
+	defer r.fp.Close()
+	if r.ndjson {
+		summary.Type = "summary"
+		return r.enc.Encode(summary)
+	}
+	doc := struct {
+		Meta    reportMeta    `json:"meta"`
+		Pairs   []reportPair  `json:"pairs"`
+		Summary reportSummary `json:"summary"`
+	}{r.meta, r.pairs, summary}
+	return r.enc.Encode(doc)
+}
+
+// reportActionResult maps an -action name and the outcome of applyAction
+// to the action value recorded in a report pair.
+func reportActionResult(actionName string, dry bool, err error) string {
+	if err != nil {
+		return "error"
+	}
+	if dry || actionName == "print" {
+		return "found"
+	}
+	switch actionName {
+	case "delete":
+		return "deleted"
+	case "hardlink":
+		return "hardlinked"
+	case "move":
+		return "moved"
+	default:
+		return "found"
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenReportFormatInference(t *testing.T) {
+	cases := []struct {
+		path       string
+		format     string
+		wantNDJSON bool
+	}{
+		{"run.json", "", false},
+		{"run.ndjson", "", true},
+		{"run.jsonl", "", true},
+		{"run.json", "ndjson", true},
+		{"run", "", false},
+	}
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), c.path)
+		rep, err := openReport(path, c.format)
+		if err != nil {
+			t.Fatalf("openReport(%q, %q): %v", c.path, c.format, err)
+		}
+		if rep.ndjson != c.wantNDJSON {
+			t.Errorf("openReport(%q, %q).ndjson = %v, want %v", c.path, c.format, rep.ndjson, c.wantNDJSON)
+		}
+		rep.close(reportSummary{})
+	}
+}
+
+func TestReportJSONFraming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json")
+	rep, err := openReport(path, "")
+	if err != nil {
+		t.Fatalf("openReport: %v", err)
+	}
+	rep.writeMeta(reportMeta{Keep: "/k", Clean: "/c", Action: "delete", Hash: "sha256"})
+	rep.addPair(reportPair{Keep: "/k/a", Clean: "/c/a", Size: 1, Hash: "abc", Action: "deleted"})
+	rep.close(reportSummary{FileCount: 1, ByteCount: 1})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading report: %v", err)
+	}
+
+	var doc struct {
+		Meta    reportMeta    `json:"meta"`
+		Pairs   []reportPair  `json:"pairs"`
+		Summary reportSummary `json:"summary"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unmarshaling single JSON document: %v\ngot: %s", err, data)
+	}
+	if doc.Meta.Keep != "/k" || len(doc.Pairs) != 1 || doc.Summary.FileCount != 1 {
+		t.Errorf("unexpected JSON document contents: %+v", doc)
+	}
+	if strings.Count(string(data), "\n") > 1 {
+		t.Errorf("JSON report should be one buffered document, got multiple lines:\n%s", data)
+	}
+}
+
+func TestReportNDJSONFraming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.ndjson")
+	rep, err := openReport(path, "")
+	if err != nil {
+		t.Fatalf("openReport: %v", err)
+	}
+	rep.writeMeta(reportMeta{Keep: "/k", Clean: "/c", Action: "delete", Hash: "sha256"})
+	rep.addPair(reportPair{Keep: "/k/a", Clean: "/c/a", Size: 1, Hash: "abc", Action: "deleted"})
+	rep.close(reportSummary{FileCount: 1, ByteCount: 1})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading report: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("NDJSON report has %d lines, want 3 (meta, pair, summary): %v", len(lines), lines)
+	}
+
+	types := []string{"meta", "pair", "summary"}
+	for i, line := range lines {
+		var rec struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("unmarshaling NDJSON line %d: %v\nline: %s", i, err, line)
+		}
+		if rec.Type != types[i] {
+			t.Errorf("NDJSON line %d has type %q, want %q", i, rec.Type, types[i])
+		}
+	}
+}
+
+func TestReportNilIsNoOp(t *testing.T) {
+	var rep *report
+	if err := rep.writeMeta(reportMeta{}); err != nil {
+		t.Errorf("writeMeta on nil report: %v", err)
+	}
+	if err := rep.addPair(reportPair{}); err != nil {
+		t.Errorf("addPair on nil report: %v", err)
+	}
+	if err := rep.close(reportSummary{}); err != nil {
+		t.Errorf("close on nil report: %v", err)
+	}
+}